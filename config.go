@@ -0,0 +1,401 @@
+package ssh_config
+
+import (
+	"io"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// Host is one `Host` or `Match` section of a config file: either a Host
+// pattern list, or a parsed Match criteria list (see isMatch), plus the
+// lines that belong to it.
+type Host struct {
+	Patterns []*Pattern        // Host's pattern list; nil for a Match block
+	Criteria []*MatchCriterion // Match's criteria list; nil for a Host block
+	Nodes    []*line
+
+	implicit bool  // synthesized to hold lines that precede the first Host/Match
+	header   *line // the literal "Host ..."/"Match ..." line, nil for implicit
+	isMatch  bool  // true for a Match block, false for Host (or implicit)
+}
+
+// Matches reports whether alias satisfies this Host's pattern list: a
+// matching negated pattern excludes alias wherever it appears in the list,
+// and otherwise alias matches if any positive pattern does.
+// It treats a Match block as never matching a bare alias; use matches with a
+// MatchContext to evaluate one.
+func (h *Host) Matches(alias string) bool {
+	if h.isMatch {
+		return false
+	}
+	return matchPatterns(h.Patterns, alias)
+}
+
+// matches reports whether this Host/Match block applies under mctx: a Host
+// block matches mctx.OriginalHost exactly as Matches(alias) does, and a
+// Match block matches if every one of its criteria does (OpenSSH ANDs them
+// together).
+func (h *Host) matches(mctx MatchContext, tags []string) bool {
+	if h.isMatch {
+		for _, c := range h.Criteria {
+			if !c.matches(mctx, tags) {
+				return false
+			}
+		}
+		return true
+	}
+	return matchPatterns(h.Patterns, mctx.OriginalHost)
+}
+
+// isFinal reports whether this Match block has a "final" criterion.
+func (h *Host) isFinal() bool {
+	for _, c := range h.Criteria {
+		if c.Kind == "final" {
+			return true
+		}
+	}
+	return false
+}
+
+// label describes this Host/Match block for diagnostics (Diff), e.g. "Host
+// *.example.com" or "Match host foo.com user admin". It returns
+// "<implicit>" for the synthesized block holding lines before the first
+// Host/Match.
+func (h *Host) label() string {
+	if h.header == nil {
+		return "<implicit>"
+	}
+	return strings.TrimSpace(h.header.body)
+}
+
+func (h *Host) String() string {
+	var b strings.Builder
+	if h.header != nil {
+		b.WriteString(h.header.String())
+	}
+	for _, n := range h.Nodes {
+		b.WriteString(n.String())
+	}
+	return b.String()
+}
+
+// Config is a parsed ssh_config file. Files pulled in via Include are not
+// stored in it; Get/GetAll read and parse them each time they follow an
+// Include directive.
+type Config struct {
+	Hosts []*Host
+}
+
+// Decode parses an ssh_config file. It does not itself read Include targets
+// from disk; that happens lazily, each time Get/GetAll follow one, so Decode
+// never fails (or touches the filesystem) because an Include target happens
+// not to exist yet.
+func Decode(r io.Reader) (*Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBytes(data), nil
+}
+
+func decodeBytes(data []byte) *Config {
+	cfg := &Config{}
+	cur := &Host{implicit: true, Patterns: []*Pattern{wildcardPattern()}}
+	cfg.Hosts = append(cfg.Hosts, cur)
+
+	for _, raw := range splitLines(data) {
+		l := parseLine(raw)
+		switch l.kind {
+		case kindHost:
+			cur = &Host{header: l, Patterns: compilePatterns(hostPatterns(l.body))}
+			cfg.Hosts = append(cfg.Hosts, cur)
+		case kindMatch:
+			cur = &Host{header: l, isMatch: true, Criteria: matchCriteria(l.body)}
+			cfg.Hosts = append(cfg.Hosts, cur)
+		default:
+			cur.Nodes = append(cur.Nodes, l)
+		}
+	}
+	return cfg
+}
+
+func wildcardPattern() *Pattern {
+	p, _ := NewPattern("*")
+	return p
+}
+
+func compilePatterns(raw []string) []*Pattern {
+	patterns := make([]*Pattern, 0, len(raw))
+	for _, r := range raw {
+		if p, err := NewPattern(r); err == nil {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// String reproduces the original bytes Decode was given, including
+// comments, blank lines, whitespace, quoting style and line endings.
+func (c *Config) String() string {
+	var b strings.Builder
+	for _, h := range c.Hosts {
+		b.WriteString(h.String())
+	}
+	return b.String()
+}
+
+// getContext carries the state that needs to thread through a lookup as it
+// follows Include directives and evaluates Match blocks: where relative
+// Include targets resolve against, how deep we've recursed, which Storage
+// backs the reads, and the (fully resolved, see resolveMatchContext)
+// MatchContext and tag set Host/Match blocks are matched against.
+type getContext struct {
+	baseDir string
+	depth   int
+	storage Storage
+
+	mctx MatchContext
+	tags []string
+}
+
+// defaultMatchContext synthesizes the MatchContext Get/GetAll use when the
+// caller hasn't supplied one: OriginalHost and Host both equal alias, and
+// User/LocalUser default to the current OS user.
+func defaultMatchContext(alias string) MatchContext {
+	u := currentUser()
+	return MatchContext{OriginalHost: alias, Host: alias, User: u, LocalUser: u}
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// defaultCtx is the getContext Config's own Get/GetAll/GetSplits/
+// GetAllSplits walk with: Include targets resolve relative to the current
+// directory, read straight off the local filesystem. UserSettings uses
+// resolveCtx directly with its own baseDir/Storage instead.
+func (c *Config) defaultCtx() getContext {
+	return getContext{baseDir: ".", storage: defaultStorage}
+}
+
+// resolveCtx runs Match's first pass (resolveMatchContext) over c using
+// base for Include resolution, and returns the getContext Get/GetAll
+// should walk c with.
+func (c *Config) resolveCtx(mctx MatchContext, base getContext) getContext {
+	resolved, tags := resolveMatchContext(c.Hosts, mctx, base)
+	base.mctx, base.tags = resolved, tags
+	return base
+}
+
+// Get returns the first value for key in the Host/Match block(s) matching
+// alias, following Include directives. It returns "" with a nil error if
+// nothing matches.
+func (c *Config) Get(alias, key string) (string, error) {
+	vals, err := c.getAll(key, false, c.resolveCtx(defaultMatchContext(alias), c.defaultCtx()))
+	if err != nil {
+		return "", err
+	}
+	if len(vals) == 0 {
+		return "", nil
+	}
+	return cookValue(vals[0]), nil
+}
+
+// GetAll returns every value for key across all matching Host/Match blocks,
+// in file order, following Include directives.
+func (c *Config) GetAll(alias, key string) ([]string, error) {
+	vals, err := c.getAll(key, true, c.resolveCtx(defaultMatchContext(alias), c.defaultCtx()))
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		vals[i] = cookValue(v)
+	}
+	return vals, nil
+}
+
+// GetSplits is like Get, but tokenizes the value the way a shell would
+// (honoring quotes) for space-separated multi-value keys.
+func (c *Config) GetSplits(alias, key string) ([]string, error) {
+	vals, err := c.getAll(key, false, c.resolveCtx(defaultMatchContext(alias), c.defaultCtx()))
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	return tokenize(vals[0]), nil
+}
+
+// GetAllSplits is GetAll followed by GetSplits-style tokenizing of every
+// value, flattened into a single slice.
+func (c *Config) GetAllSplits(alias, key string) ([]string, error) {
+	vals, err := c.getAll(key, true, c.resolveCtx(defaultMatchContext(alias), c.defaultCtx()))
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, v := range vals {
+		out = append(out, tokenize(v)...)
+	}
+	return out, nil
+}
+
+func (c *Config) getAll(key string, all bool, ctx getContext) ([]string, error) {
+	results, _, err := c.getAllSrc(key, all, ctx)
+	return results, err
+}
+
+// getAllSrc is getAll, but also reports which Host/Match block each
+// returned value came from (results[i] came from hosts[i]), so callers
+// that need to attribute a value (Diff) don't have to walk the tree twice.
+func (c *Config) getAllSrc(key string, all bool, ctx getContext) ([]string, []*Host, error) {
+	var results []string
+	var hosts []*Host
+	visit := func(v string, h *Host) bool {
+		results = append(results, v)
+		hosts = append(hosts, h)
+		return all
+	}
+	_, err := walkHosts(c.Hosts, key, ctx, visit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return results, hosts, nil
+}
+
+// walkHosts iterates hosts in file order, descending into the nodes of each
+// one that matches ctx.mctx. visit returns true to keep going (collecting
+// more matches) or false to stop; walkHosts returns true if visit asked to
+// stop.
+func walkHosts(hosts []*Host, key string, ctx getContext, visit func(string, *Host) bool) (bool, error) {
+	for _, h := range hosts {
+		if !h.implicit && !h.matches(ctx.mctx, ctx.tags) {
+			continue
+		}
+		stop, err := walkNodes(h, h.Nodes, key, ctx, visit)
+		if err != nil {
+			return false, err
+		}
+		if stop {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func walkNodes(h *Host, nodes []*line, key string, ctx getContext, visit func(string, *Host) bool) (bool, error) {
+	for _, n := range nodes {
+		if n.kind != kindKV {
+			continue
+		}
+		if strings.EqualFold(n.key, "Include") {
+			if ctx.depth+1 > maxIncludeDepth {
+				return false, ErrDepthExceeded
+			}
+			subs, err := expandInclude(n, ctx)
+			if err != nil {
+				return false, err
+			}
+			nctx := getContext{baseDir: ctx.baseDir, depth: ctx.depth + 1, storage: ctx.storage, mctx: ctx.mctx, tags: ctx.tags}
+			for _, sub := range subs {
+				rest := sub.Hosts
+				if len(rest) > 0 && rest[0].implicit {
+					stop, err := walkNodes(rest[0], rest[0].Nodes, key, nctx, visit)
+					if err != nil {
+						return false, err
+					}
+					if stop {
+						return true, nil
+					}
+					rest = rest[1:]
+				}
+				stop, err := walkHosts(rest, key, nctx, visit)
+				if err != nil {
+					return false, err
+				}
+				if stop {
+					return true, nil
+				}
+			}
+			continue
+		}
+		if strings.EqualFold(n.key, key) {
+			if !visit(n.Value(), h) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// resolveIncludeTargets expands an Include directive's (possibly multiple,
+// possibly glob) arguments into concrete file paths, along with the Storage
+// they should be read through.
+func resolveIncludeTargets(n *line, ctx getContext) (storage Storage, files []string, err error) {
+	storage = ctx.storage
+	if storage == nil {
+		storage = defaultStorage
+	}
+	for _, tok := range tokenize(n.Value()) {
+		resolved := storage.Resolve(ctx.baseDir, tok)
+		matches, err := storage.Glob(resolved)
+		if err != nil {
+			return storage, nil, err
+		}
+		if len(matches) == 0 {
+			if _, err := storage.Stat(resolved); err == nil {
+				matches = []string{resolved}
+			}
+		}
+		files = append(files, matches...)
+	}
+	return storage, files, nil
+}
+
+// decodeFile reads and parses a single file through storage, for callers
+// (resolveMatchContext) that need one file at a time rather than every file
+// an Include directive's argument list expands to.
+func decodeFile(storage Storage, path string) (*Config, error) {
+	rc, err := storage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBytes(data), nil
+}
+
+// expandInclude resolves and parses every file an Include directive refers
+// to, without recursing into them (the caller handles recursion/depth).
+func expandInclude(n *line, ctx getContext) ([]*Config, error) {
+	storage, files, err := resolveIncludeTargets(n, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*Config
+	for _, f := range files {
+		rc, err := storage.Open(f)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, decodeBytes(data))
+	}
+	return out, nil
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"testing/fstest"
 )
 
 func loadFile(t *testing.T, filename string) []byte {
@@ -353,6 +354,22 @@ func TestIncludeSystem(t *testing.T) {
 	}
 }
 
+func TestIncludeWithCustomStorage(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/alice/.ssh/config": {Data: []byte("Host *\n    Include extra\n")},
+		"home/alice/.ssh/extra":  {Data: []byte("Host kevinburke.ssh_config.test.example.com\n    Port 4567\n")},
+	}
+	us := &UserSettings{
+		userConfigFinder: func() string { return "home/alice/.ssh/config" },
+	}
+	us.SetStorage(NewFSStorage(fsys))
+
+	val := us.Get("kevinburke.ssh_config.test.example.com", "Port")
+	if val != "4567" {
+		t.Errorf("expected Port=4567 via Include resolved against the custom Storage's config dir, got %q", val)
+	}
+}
+
 var recursiveIncludeFile = []byte(`
 Host kevinburke.ssh_config.test.example.com
 	Include kevinburke-ssh-config-recursive-include
@@ -448,6 +465,304 @@ func TestMatchUnsupported(t *testing.T) {
 	}
 }
 
+func TestMatchHostCriterion(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder: testConfigFinder("testdata/match-criteria"),
+	}
+	val, err := us.GetStrict("match.example.com", "Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "1111" {
+		t.Errorf("Get(match.example.com, Port) = %q, want %q", val, "1111")
+	}
+}
+
+func TestMatchUserCriterion(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder: testConfigFinder("testdata/match-criteria"),
+	}
+	val, err := us.GetWithContext(MatchContext{User: "admin"}, "other.example.com", "Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "2222" {
+		t.Errorf("GetWithContext(user=admin) = %q, want %q", val, "2222")
+	}
+}
+
+func TestMatchExecCriterion(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder: testConfigFinder("testdata/match-criteria"),
+	}
+	var gotCmd string
+	ctx := MatchContext{
+		ExecRunner: func(cmd string) bool {
+			gotCmd = cmd
+			return true
+		},
+	}
+	val, err := us.GetWithContext(ctx, "other.example.com", "Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "3333" {
+		t.Errorf("GetWithContext(exec) = %q, want %q", val, "3333")
+	}
+	if want := "check other.example.com"; gotCmd != want {
+		t.Errorf("exec criterion ran %q, want %q (want %%h expanded)", gotCmd, want)
+	}
+}
+
+func TestMatchFinalCriterion(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder: testConfigFinder("testdata/match-criteria"),
+	}
+	ctx := MatchContext{ExecRunner: func(string) bool { return false }}
+	val, err := us.GetWithContext(ctx, "canonical.example.com", "Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "4444" {
+		t.Errorf("GetWithContext(final) = %q, want %q", val, "4444")
+	}
+}
+
+func TestMatchFallsThroughToHost(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder: testConfigFinder("testdata/match-criteria"),
+	}
+	ctx := MatchContext{ExecRunner: func(string) bool { return false }}
+	val, err := us.GetWithContext(ctx, "unmatched.example.com", "Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "22" {
+		t.Errorf("GetWithContext(no Match block applies) = %q, want %q", val, "22")
+	}
+}
+
+func decodeTestdata(t *testing.T, path string) *Config {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDiff(t *testing.T) {
+	a := decodeTestdata(t, "testdata/diff-a")
+	b := decodeTestdata(t, "testdata/diff-b")
+
+	diffs := Diff(a, b)
+	if len(diffs) != 1 {
+		t.Fatalf("Diff: got %d diffs, want 1: %+v", len(diffs), diffs)
+	}
+	d := diffs[0]
+	if d.Field != "IdentityFile" {
+		t.Errorf("Field = %q, want %q", d.Field, "IdentityFile")
+	}
+	wantA := []string{"~/.ssh/id_a", "~/.ssh/id_shared"}
+	wantB := []string{"~/.ssh/id_shared", "~/.ssh/id_b"}
+	if !sameSet(d.ValuesA, wantA) {
+		t.Errorf("ValuesA = %v, want set %v", d.ValuesA, wantA)
+	}
+	if !sameSet(d.ValuesB, wantB) {
+		t.Errorf("ValuesB = %v, want set %v", d.ValuesB, wantB)
+	}
+	if d.DefaultA || d.DefaultB {
+		t.Errorf("DefaultA/DefaultB = %v/%v, want false/false", d.DefaultA, d.DefaultB)
+	}
+}
+
+func TestDiffPerHostBlock(t *testing.T) {
+	a := decodeTestdata(t, "testdata/diff-host-a")
+	b := decodeTestdata(t, "testdata/diff-host-b")
+
+	diffs := Diff(a, b)
+	if len(diffs) != 1 {
+		t.Fatalf("Diff: got %d diffs, want 1: %+v", len(diffs), diffs)
+	}
+	d := diffs[0]
+	if d.Field != "Port" {
+		t.Errorf("Field = %q, want %q", d.Field, "Port")
+	}
+	if !sameSet(d.ValuesA, []string{"22"}) || !sameSet(d.ValuesB, []string{"2222"}) {
+		t.Errorf("ValuesA/ValuesB = %v/%v, want [22]/[2222]", d.ValuesA, d.ValuesB)
+	}
+}
+
+func TestDiffMultiPatternHostLineNotDuplicated(t *testing.T) {
+	a, err := Decode(bytes.NewReader([]byte("Host web1 web2\n    Port 22\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Decode(bytes.NewReader([]byte("Host web1 web2\n    Port 2222\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs := Diff(a, b)
+	if len(diffs) != 1 {
+		t.Fatalf("Diff: got %d diffs, want 1: %+v", len(diffs), diffs)
+	}
+}
+
+func TestUserSettingsDiffHosts(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder: testConfigFinder("testdata/diff-hosts"),
+	}
+	diffs := us.DiffHosts("web1", "web2")
+	if len(diffs) != 1 {
+		t.Fatalf("DiffHosts: got %d diffs, want 1: %+v", len(diffs), diffs)
+	}
+	d := diffs[0]
+	if d.Field != "Port" {
+		t.Errorf("Field = %q, want %q", d.Field, "Port")
+	}
+	if !sameSet(d.ValuesA, []string{"22"}) || !sameSet(d.ValuesB, []string{"2222"}) {
+		t.Errorf("ValuesA/ValuesB = %v/%v, want [22]/[2222]", d.ValuesA, d.ValuesB)
+	}
+	if d.SourceA != "user: Host web1" || d.SourceB != "user: Host web2" {
+		t.Errorf("SourceA/SourceB = %q/%q, want %q/%q", d.SourceA, d.SourceB, "user: Host web1", "user: Host web2")
+	}
+}
+
+func TestSetHostRewritesExistingValue(t *testing.T) {
+	src := "Host foo\r\n" +
+		"    Port 22\r\n" +
+		"    User = alice\r\n" +
+		"\r\n" +
+		"Host bar\r\n" +
+		"    Port 2222\r\n"
+	cfg, err := Decode(bytes.NewReader([]byte(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SetHost("foo", "Port", "2200")
+	cfg.SetHost("foo", "user", "bob")
+
+	want := "Host foo\r\n" +
+		"    Port 2200\r\n" +
+		"    User = bob\r\n" +
+		"\r\n" +
+		"Host bar\r\n" +
+		"    Port 2222\r\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() mismatch:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestSetHostAppendsNewLine(t *testing.T) {
+	src := "Host foo\n    Port 22\n"
+	cfg, err := Decode(bytes.NewReader([]byte(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SetHost("foo", "User", "has space")
+
+	want := "Host foo\n    Port 22\n    User \"has space\"\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() mismatch:\ngot:  %q\nwant: %q", got, want)
+	}
+	val, err := cfg.Get("foo", "User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "has space" {
+		t.Errorf("Get(User) = %q, want %q", val, "has space")
+	}
+}
+
+func TestAppendHostAccumulates(t *testing.T) {
+	cfg, err := Decode(bytes.NewReader([]byte("Host foo\n    IdentityFile ~/.ssh/id_a\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AppendHost("foo", "IdentityFile", "~/.ssh/id_b")
+
+	want := "Host foo\n    IdentityFile ~/.ssh/id_a\n    IdentityFile ~/.ssh/id_b\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() mismatch:\ngot:  %q\nwant: %q", got, want)
+	}
+	vals, err := cfg.GetAll("foo", "IdentityFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vals, []string{"~/.ssh/id_a", "~/.ssh/id_b"}) {
+		t.Errorf("GetAll(IdentityFile) = %v", vals)
+	}
+}
+
+func TestUnsetHost(t *testing.T) {
+	cfg, err := Decode(bytes.NewReader([]byte("Host foo\n    Port 22\n    User alice\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.UnsetHost("foo", "Port")
+
+	want := "Host foo\n    User alice\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() mismatch:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestSetHostQuotesDoubleQuoteValue(t *testing.T) {
+	cfg, err := Decode(bytes.NewReader([]byte("Host foo\n    Port 22\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SetHost("foo", "Comment", `say "hi" to me`)
+
+	want := "Host foo\n    Port 22\n    Comment 'say \"hi\" to me'\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() mismatch:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestAddHostAndRemoveHost(t *testing.T) {
+	cfg, err := Decode(bytes.NewReader([]byte("Host foo\n    Port 22\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := cfg.AddHost([]string{"bar", "*.bar.example.com"})
+	cfg.SetHost("bar", "Port", "2222")
+	if len(h.Nodes) != 1 {
+		t.Fatalf("AddHost returned Host with %d nodes, want 1", len(h.Nodes))
+	}
+
+	want := "Host foo\n    Port 22\n\nHost bar *.bar.example.com\n    Port 2222\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() after AddHost/SetHost mismatch:\ngot:  %q\nwant: %q", got, want)
+	}
+
+	cfg.RemoveHost("bar")
+	want = "Host foo\n    Port 22\n\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() after RemoveHost mismatch:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestAddHostMatchesFileEOLStyle(t *testing.T) {
+	src := "Host foo\r\n    Port 22\r\n"
+	cfg, err := Decode(bytes.NewReader([]byte(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AddHost([]string{"bar"})
+	cfg.SetHost("bar", "Port", "2222")
+
+	want := "Host foo\r\n    Port 22\r\n\r\nHost bar\r\n    Port 2222\r\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() mismatch:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
 func TestIndexInRange(t *testing.T) {
 	us := &UserSettings{
 		userConfigFinder: testConfigFinder("testdata/config4"),
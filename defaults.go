@@ -0,0 +1,44 @@
+package ssh_config
+
+import "sync"
+
+// defaultProtocol2Identities lists the identity files OpenSSH tries under
+// the protocol-2-only default, in order. ssh_config itself only returns the
+// single-value default (IdentityFile -> ~/.ssh/identity); callers that want
+// the full fleet of protocol-2 defaults can fall back to this list
+// themselves.
+var defaultProtocol2Identities = []string{
+	"~/.ssh/id_rsa",
+	"~/.ssh/id_dsa",
+	"~/.ssh/id_ecdsa",
+	"~/.ssh/id_ed25519",
+}
+
+var (
+	defaultsMu sync.RWMutex
+	defaults   = map[string]string{
+		"IdentityFile":          "~/.ssh/identity",
+		"Port":                  "22",
+		"Protocol":              "2",
+		"Compression":           "no",
+		"TCPKeepAlive":          "yes",
+		"StrictHostKeyChecking": "ask",
+		"ConnectionAttempts":    "1",
+	}
+)
+
+// Default returns the built-in default value for key, or "" if none is
+// registered.
+func Default(key string) string {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return defaults[key]
+}
+
+// SetDefault overrides the built-in default value for key. Passing "" makes
+// lookups behave as if the key has no default at all.
+func SetDefault(key, value string) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaults[key] = value
+}
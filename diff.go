@@ -0,0 +1,305 @@
+package ssh_config
+
+import (
+	"sort"
+	"strings"
+)
+
+// FieldDiff is one directive whose resolved value differs between two
+// sides being compared by Diff or UserSettings.DiffHosts. Values are
+// tokenized the way GetAllSplits would, so a multi-valued directive (e.g.
+// IdentityFile, UserKnownHostsFile, SetEnv) is compared as a set rather
+// than as a single raw string.
+type FieldDiff struct {
+	Field string
+
+	ValuesA []string
+	ValuesB []string
+
+	// SourceA/SourceB describe which Host/Match block (or "<default>")
+	// supplied ValuesA/ValuesB, e.g. "Host *.example.com".
+	SourceA string
+	SourceB string
+
+	// DefaultA/DefaultB are true when nothing in the config matched and a
+	// registered default (see Default) filled the value in instead.
+	DefaultA bool
+	DefaultB bool
+}
+
+// Diff compares a and b's resolved settings for one representative alias
+// per Host block declared in either file (its first non-negated pattern,
+// see configAliases; not just the wildcard host "*"), and reports every
+// directive whose value differs for that alias. A config made up of
+// per-host blocks (e.g. "Host web1") is compared block by block this way,
+// the same as one that's just a single "Host *". Use UserSettings.DiffHosts
+// to compare two aliases within one combined user+system config instead.
+func Diff(a, b *Config) []FieldDiff {
+	var diffs []FieldDiff
+	for _, alias := range mergeAliases(configAliases(a), configAliases(b)) {
+		for _, key := range mergeKeys(configKeys(a, a.defaultCtx()), configKeys(b, b.defaultCtx())) {
+			valsA, srcA, defA, err := resolveConfigField(a, alias, key)
+			if err != nil {
+				continue
+			}
+			valsB, srcB, defB, err := resolveConfigField(b, alias, key)
+			if err != nil {
+				continue
+			}
+			if d := diffField(key, valsA, valsB, srcA, srcB, defA, defB); d != nil {
+				diffs = append(diffs, *d)
+			}
+		}
+	}
+	return diffs
+}
+
+// DiffHosts compares the settings aliasA and aliasB resolve to within u's
+// combined user config, system config, and registered defaults, and
+// reports every directive whose value differs. It's meant for auditing two
+// aliases that are supposed to inherit identically.
+func (u *UserSettings) DiffHosts(aliasA, aliasB string) []FieldDiff {
+	var diffs []FieldDiff
+	for _, key := range mergeKeys(u.allKeys(), u.allKeys()) {
+		valsA, srcA, defA, err := u.resolveField(aliasA, key)
+		if err != nil {
+			continue
+		}
+		valsB, srcB, defB, err := u.resolveField(aliasB, key)
+		if err != nil {
+			continue
+		}
+		if d := diffField(key, valsA, valsB, srcA, srcB, defA, defB); d != nil {
+			diffs = append(diffs, *d)
+		}
+	}
+	return diffs
+}
+
+// resolveConfigField resolves key for alias within c, returning the
+// tokenized value set, a label for the Host/Match block that supplied it
+// (or "<default>"), and whether a registered default filled it in.
+func resolveConfigField(c *Config, alias, key string) (vals []string, source string, isDefault bool, err error) {
+	ctx := c.resolveCtx(defaultMatchContext(alias), c.defaultCtx())
+	results, hosts, err := c.getAllSrc(key, true, ctx)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if len(results) == 0 {
+		if def := Default(key); def != "" {
+			return []string{def}, "<default>", true, nil
+		}
+		return nil, "", false, nil
+	}
+	return flattenTokens(results), hosts[0].label(), false, nil
+}
+
+// resolveField is resolveConfigField, layered across u's user config,
+// system config, and registered defaults: it returns the user config's
+// values if it sets key at all, otherwise the system config's, otherwise a
+// registered default. Unlike UserSettings.GetAll, it never combines values
+// from both configs.
+func (u *UserSettings) resolveField(alias, key string) (vals []string, source string, isDefault bool, err error) {
+	u.load()
+	u.mu.RLock()
+	userCfg, system, loadErr := u.user, u.system, u.loadErr
+	u.mu.RUnlock()
+	if loadErr != nil {
+		return nil, "", false, loadErr
+	}
+
+	mctx := defaultMatchContext(alias)
+	if userCfg != nil {
+		base := getContext{baseDir: u.userBaseDir(), storage: u.storageOrDefault()}
+		results, hosts, err := userCfg.getAllSrc(key, true, userCfg.resolveCtx(mctx, base))
+		if err != nil {
+			return nil, "", false, err
+		}
+		if len(results) > 0 {
+			return flattenTokens(results), "user: " + hosts[0].label(), false, nil
+		}
+	}
+	if system != nil {
+		base := getContext{baseDir: u.systemBaseDir(), storage: u.storageOrDefault()}
+		results, hosts, err := system.getAllSrc(key, true, system.resolveCtx(mctx, base))
+		if err != nil {
+			return nil, "", false, err
+		}
+		if len(results) > 0 {
+			return flattenTokens(results), "system: " + hosts[0].label(), false, nil
+		}
+	}
+	if def := Default(key); def != "" {
+		return []string{def}, "<default>", true, nil
+	}
+	return nil, "", false, nil
+}
+
+func flattenTokens(raw []string) []string {
+	var out []string
+	for _, v := range raw {
+		out = append(out, tokenize(v)...)
+	}
+	return out
+}
+
+func diffField(key string, valsA, valsB []string, srcA, srcB string, defA, defB bool) *FieldDiff {
+	if sameSet(valsA, valsB) {
+		return nil
+	}
+	return &FieldDiff{
+		Field:    key,
+		ValuesA:  valsA,
+		ValuesB:  valsB,
+		SourceA:  srcA,
+		SourceB:  srcB,
+		DefaultA: defA,
+		DefaultB: defB,
+	}
+}
+
+// sameSet reports whether a and b contain the same values, ignoring order
+// (so reordering multi-valued directives like IdentityFile isn't a diff).
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, v := range a {
+		counts[v]++
+	}
+	for _, v := range b {
+		counts[v]--
+		if counts[v] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// configKeys returns every directive key (original casing of its first
+// occurrence, sorted case-insensitively) that appears anywhere in c,
+// following Include (resolved against base's directory and Storage) so a
+// config split across files still diffs completely. A broken or too-deep
+// Include chain just contributes no extra keys rather than failing the
+// whole diff.
+func configKeys(c *Config, base getContext) []string {
+	seen := map[string]string{}
+	var walk func(nodes []*line, ctx getContext)
+	walk = func(nodes []*line, ctx getContext) {
+		for _, n := range nodes {
+			if n.kind != kindKV {
+				continue
+			}
+			if strings.EqualFold(n.key, "Include") {
+				if ctx.depth+1 > maxIncludeDepth {
+					continue
+				}
+				subs, err := expandInclude(n, ctx)
+				if err != nil {
+					continue
+				}
+				nctx := getContext{baseDir: ctx.baseDir, depth: ctx.depth + 1, storage: ctx.storage}
+				for _, sub := range subs {
+					for _, h := range sub.Hosts {
+						walk(h.Nodes, nctx)
+					}
+				}
+				continue
+			}
+			if _, ok := seen[strings.ToLower(n.key)]; !ok {
+				seen[strings.ToLower(n.key)] = n.key
+			}
+		}
+	}
+	for _, h := range c.Hosts {
+		walk(h.Nodes, base)
+	}
+	return sortedValues(seen)
+}
+
+// configAliases returns one representative alias per literal Host block
+// declared anywhere in c (ignoring Match blocks and the implicit catch-all
+// host) — its first non-negated pattern — in declaration order and
+// deduped, so Diff can compare each Host block on its own instead of
+// assuming the whole file is a single "Host *". Using every pattern on a
+// multi-pattern Host line (e.g. "Host web1 web2") would resolve and
+// compare the same block's fields once per pattern, reporting duplicate
+// diffs for what is really a single changed block.
+func configAliases(c *Config) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, h := range c.Hosts {
+		if h.implicit || h.isMatch {
+			continue
+		}
+		var alias string
+		for _, p := range hostPatterns(h.header.body) {
+			if !strings.HasPrefix(p, "!") {
+				alias = p
+				break
+			}
+		}
+		if alias == "" || seen[alias] {
+			continue
+		}
+		seen[alias] = true
+		out = append(out, alias)
+	}
+	return out
+}
+
+// mergeAliases dedupes two alias lists, preserving a's order then b's.
+func mergeAliases(a, b []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, alias := range append(append([]string{}, a...), b...) {
+		if !seen[alias] {
+			seen[alias] = true
+			out = append(out, alias)
+		}
+	}
+	return out
+}
+
+// allKeys is configKeys for both of u's user and system configs combined.
+func (u *UserSettings) allKeys() []string {
+	u.load()
+	u.mu.RLock()
+	userCfg, system := u.user, u.system
+	u.mu.RUnlock()
+
+	var keys []string
+	if userCfg != nil {
+		keys = append(keys, configKeys(userCfg, getContext{baseDir: u.userBaseDir(), storage: u.storageOrDefault()})...)
+	}
+	if system != nil {
+		keys = append(keys, configKeys(system, getContext{baseDir: u.systemBaseDir(), storage: u.storageOrDefault()})...)
+	}
+	return keys
+}
+
+// mergeKeys case-insensitively dedupes and sorts two key lists.
+func mergeKeys(a, b []string) []string {
+	seen := map[string]string{}
+	for _, k := range append(append([]string{}, a...), b...) {
+		lower := strings.ToLower(k)
+		if _, ok := seen[lower]; !ok {
+			seen[lower] = k
+		}
+	}
+	return sortedValues(seen)
+}
+
+func sortedValues(byLowerKey map[string]string) []string {
+	lowers := make([]string, 0, len(byLowerKey))
+	for lower := range byLowerKey {
+		lowers = append(lowers, lower)
+	}
+	sort.Strings(lowers)
+	out := make([]string, len(lowers))
+	for i, lower := range lowers {
+		out[i] = byLowerKey[lower]
+	}
+	return out
+}
@@ -0,0 +1,11 @@
+package ssh_config
+
+import "errors"
+
+// ErrDepthExceeded is returned when a chain of Include directives nests
+// more deeply than maxIncludeDepth, which usually means two files include
+// each other (directly or transitively).
+var ErrDepthExceeded = errors.New("ssh_config: max include depth exceeded")
+
+// maxIncludeDepth mirrors OpenSSH's own limit on recursive Include chains.
+const maxIncludeDepth = 5
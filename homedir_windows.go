@@ -0,0 +1,15 @@
+//go:build windows
+
+package ssh_config
+
+import "os"
+
+func homedir() string {
+	if h := os.Getenv("USERPROFILE"); h != "" {
+		return h
+	}
+	if h, err := os.UserHomeDir(); err == nil {
+		return h
+	}
+	return ""
+}
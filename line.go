@@ -0,0 +1,194 @@
+package ssh_config
+
+import "strings"
+
+// lineKind classifies a single raw line of a config file.
+type lineKind int
+
+const (
+	kindBlank lineKind = iota
+	kindComment
+	kindHost
+	kindMatch
+	kindKV
+)
+
+// line is one physical line of a config file. String() always reconstructs
+// the original bytes exactly (leading + body + eol partition the line), so
+// round-tripping a parsed Config never depends on how body is interpreted.
+type line struct {
+	leading string
+	body    string // everything after leading whitespace, before the eol
+	eol     string // "\n", "\r\n", or "" for a final line with no terminator
+
+	kind lineKind
+	key  string // raw key text, for kindKV/kindHost/kindMatch
+}
+
+func (l *line) String() string {
+	return l.leading + l.body + l.eol
+}
+
+// Value returns the trimmed value of a kindKV line, exactly as written
+// (including any quote characters) aside from surrounding whitespace.
+func (l *line) Value() string {
+	_, rest := splitKeyRest(l.body)
+	return strings.TrimSpace(rest)
+}
+
+// cookValue strips a single pair of quotes off raw when the whole value is
+// one quoted atom (e.g. `'foo bar'`), matching what OpenSSH hands a
+// directive whose value happens to be wrapped rather than space-separated.
+// A value made up of several tokens (quoted or not, e.g. a quoted
+// UserKnownHostsFile list) is returned unchanged, quotes and all, since
+// there's no single atom to unwrap.
+func cookValue(raw string) string {
+	if toks := tokenize(raw); len(toks) == 1 {
+		return toks[0]
+	}
+	return raw
+}
+
+func isHorizSpace(b byte) bool { return b == ' ' || b == '\t' }
+
+// splitLines breaks data into physical lines, each retaining its original
+// terminator (if any) so CRLF files and missing-final-newline files both
+// round-trip byte for byte.
+func splitLines(data []byte) []string {
+	var lines []string
+	start := 0
+	for i := 0; i < len(data); i++ {
+		if data[i] == '\n' {
+			lines = append(lines, string(data[start:i+1]))
+			start = i + 1
+		}
+	}
+	if start < len(data) {
+		lines = append(lines, string(data[start:]))
+	}
+	return lines
+}
+
+// parseLine classifies a single raw (terminator-included) line.
+func parseLine(raw string) *line {
+	text := raw
+	eol := ""
+	if strings.HasSuffix(text, "\r\n") {
+		eol = "\r\n"
+		text = text[:len(text)-2]
+	} else if strings.HasSuffix(text, "\n") {
+		eol = "\n"
+		text = text[:len(text)-1]
+	}
+
+	i := 0
+	for i < len(text) && isHorizSpace(text[i]) {
+		i++
+	}
+	leading := text[:i]
+	body := text[i:]
+
+	l := &line{leading: leading, body: body, eol: eol}
+
+	switch {
+	case body == "":
+		l.kind = kindBlank
+	case body[0] == '#':
+		l.kind = kindComment
+	default:
+		key, _ := splitKeyRest(body)
+		switch {
+		case strings.EqualFold(key, "Host"):
+			l.kind = kindHost
+			l.key = key
+		case strings.EqualFold(key, "Match"):
+			l.kind = kindMatch
+			l.key = key
+		default:
+			l.kind = kindKV
+			l.key = key
+		}
+	}
+	return l
+}
+
+// splitKeyRest splits "Key value", "Key=value", or "Key = value" into the
+// raw key and the raw remainder (the whitespace and any '=' separator
+// between them have already been consumed).
+func splitKeyRest(body string) (key, rest string) {
+	i := 0
+	for i < len(body) && !isHorizSpace(body[i]) && body[i] != '=' {
+		i++
+	}
+	key = body[:i]
+	j := i
+	for j < len(body) && isHorizSpace(body[j]) {
+		j++
+	}
+	if j < len(body) && body[j] == '=' {
+		j++
+		for j < len(body) && isHorizSpace(body[j]) {
+			j++
+		}
+	}
+	rest = body[j:]
+	return
+}
+
+// hostPatterns extracts the pattern list from a Host line's body, stopping
+// at a whitespace-delimited token that begins a trailing comment.
+func hostPatterns(body string) []string {
+	_, rest := splitKeyRest(body)
+	fields := strings.Fields(rest)
+	var out []string
+	for _, f := range fields {
+		if strings.HasPrefix(f, "#") {
+			break
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// tokenize splits a value on whitespace, honoring single and double quotes:
+// a quote opens a run where the *other* quote character and whitespace are
+// literal, and closes on its matching partner. Quote characters themselves
+// are stripped from the token.
+func tokenize(s string) []string {
+	var tokens []string
+	var b strings.Builder
+	started := false
+	var quote byte // 0 when not inside a quoted run
+
+	flush := func() {
+		if started {
+			tokens = append(tokens, b.String())
+			b.Reset()
+			started = false
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			} else {
+				b.WriteByte(c)
+			}
+			continue
+		}
+		switch {
+		case c == ' ' || c == '\t':
+			flush()
+		case c == '\'' || c == '"':
+			quote = c
+			started = true
+		default:
+			b.WriteByte(c)
+			started = true
+		}
+	}
+	flush()
+	return tokens
+}
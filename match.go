@@ -0,0 +1,254 @@
+package ssh_config
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// MatchContext carries the state a Match directive's criteria are
+// evaluated against: the host alias before (OriginalHost) and after
+// (Host) any Hostname substitution, the remote and local user, and how to
+// run an "exec" criterion's command.
+type MatchContext struct {
+	OriginalHost string
+	Host         string
+	User         string
+	LocalUser    string
+	ExecRunner   ExecRunner
+}
+
+func (mctx MatchContext) execRunner() ExecRunner {
+	if mctx.ExecRunner != nil {
+		return mctx.ExecRunner
+	}
+	return defaultExecRunner
+}
+
+// ExecRunner runs an exec Match criterion's (already %-token-expanded)
+// command and reports whether it counts as a match: by OpenSSH's rule,
+// exit status 0 matches and anything else (including a failure to start)
+// doesn't.
+type ExecRunner func(cmd string) bool
+
+func defaultExecRunner(cmd string) bool {
+	return exec.Command("/bin/sh", "-c", cmd).Run() == nil
+}
+
+// MatchCriterion is one test within a Match directive, e.g. "host
+// *.example.com" or the negated "!final".
+type MatchCriterion struct {
+	// Kind is one of "host", "originalhost", "user", "localuser",
+	// "tagged", "exec", "all", "final", "canonical".
+	Kind    string
+	Negated bool
+	// Patterns holds the compiled pattern list for host/originalhost/
+	// user/localuser/tagged; nil for the other kinds.
+	Patterns []*Pattern
+	// Arg is the raw (un-%-expanded) command for an exec criterion.
+	Arg string
+}
+
+func (c *MatchCriterion) matches(mctx MatchContext, tags []string) bool {
+	var ok bool
+	switch c.Kind {
+	case "all":
+		ok = true
+	case "final":
+		// final only controls *when* a Match block is evaluated (see
+		// resolveMatchContext and Config.getAll); by the time matches
+		// is called the block is always eligible, so the criterion
+		// itself is vacuously true.
+		ok = true
+	case "canonical":
+		// Hostname canonicalization (CanonicalizeHostname and friends)
+		// isn't implemented, so treat every host as already canonical
+		// rather than having "canonical" silently never match.
+		ok = true
+	case "host":
+		ok = matchPatterns(c.Patterns, mctx.Host)
+	case "originalhost":
+		ok = matchPatterns(c.Patterns, mctx.OriginalHost)
+	case "user":
+		ok = matchPatterns(c.Patterns, mctx.User)
+	case "localuser":
+		ok = matchPatterns(c.Patterns, mctx.LocalUser)
+	case "tagged":
+		for _, t := range tags {
+			if matchPatterns(c.Patterns, t) {
+				ok = true
+				break
+			}
+		}
+	case "exec":
+		ok = mctx.execRunner()(expandTokens(c.Arg, mctx))
+	}
+	if c.Negated {
+		return !ok
+	}
+	return ok
+}
+
+// matchPatterns reports whether s satisfies a pattern list the same way
+// Host.Matches does: a matching negated pattern excludes s wherever it
+// appears in the list; otherwise s matches if any positive pattern does.
+func matchPatterns(patterns []*Pattern, s string) bool {
+	matched := false
+	for _, p := range patterns {
+		if p.regex.MatchString(s) {
+			if p.Negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchCriteria parses the argument list of a Match line's body (the part
+// after the literal "Match") into criteria, reusing Pattern/NewPattern for
+// every criterion whose argument is a pattern list.
+func matchCriteria(body string) []*MatchCriterion {
+	_, rest := splitKeyRest(body)
+	tokens := tokenize(rest)
+	for i, t := range tokens {
+		if strings.HasPrefix(t, "#") {
+			tokens = tokens[:i]
+			break
+		}
+	}
+
+	var criteria []*MatchCriterion
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		negated := strings.HasPrefix(tok, "!")
+		kind := strings.ToLower(strings.TrimPrefix(tok, "!"))
+
+		switch kind {
+		case "all", "final", "canonical":
+			criteria = append(criteria, &MatchCriterion{Kind: kind, Negated: negated})
+		case "exec":
+			if i+1 >= len(tokens) {
+				break
+			}
+			i++
+			criteria = append(criteria, &MatchCriterion{Kind: kind, Negated: negated, Arg: tokens[i]})
+		case "host", "originalhost", "user", "localuser", "tagged":
+			if i+1 >= len(tokens) {
+				break
+			}
+			i++
+			var patterns []*Pattern
+			for _, p := range strings.Split(tokens[i], ",") {
+				if pat, err := NewPattern(p); err == nil {
+					patterns = append(patterns, pat)
+				}
+			}
+			criteria = append(criteria, &MatchCriterion{Kind: kind, Negated: negated, Patterns: patterns})
+		}
+	}
+	return criteria
+}
+
+// expandTokens replaces the %-tokens OpenSSH documents for exec/Hostname
+// arguments with values from mctx: %h (target host), %n (original host),
+// %r (remote user), %u (local user), %l (local hostname), and %% (a
+// literal percent). Any other %-sequence is left untouched.
+func expandTokens(s string, mctx MatchContext) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case 'h':
+			b.WriteString(mctx.Host)
+		case 'n':
+			b.WriteString(mctx.OriginalHost)
+		case 'r':
+			b.WriteString(mctx.User)
+		case 'u':
+			b.WriteString(mctx.LocalUser)
+		case 'l':
+			if host, err := os.Hostname(); err == nil {
+				b.WriteString(host)
+			}
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(s[i+1])
+			i++
+			continue
+		}
+		i++
+	}
+	return b.String()
+}
+
+// resolveMatchContext runs OpenSSH's first Match pass: Host blocks and
+// non-final Match blocks are evaluated against base, in file order,
+// updating Host/User/tags as Hostname/User/Tag directives are encountered
+// (first occurrence wins, same rule Get itself uses for a single-valued
+// key). A second pass (Config.getAll) then evaluates everything,
+// "Match final" blocks included, against the fully resolved result.
+func resolveMatchContext(hosts []*Host, base MatchContext, ctx getContext) (MatchContext, []string) {
+	mctx := base
+	var tags []string
+	haveHostname, haveUser := false, false
+
+	var walk func(hosts []*Host, ctx getContext)
+	walk = func(hosts []*Host, ctx getContext) {
+		for _, h := range hosts {
+			if !h.implicit && !h.matchesForResolve(mctx, tags) {
+				continue
+			}
+			for _, n := range h.Nodes {
+				if n.kind != kindKV {
+					continue
+				}
+				if strings.EqualFold(n.key, "Include") {
+					if ctx.depth+1 > maxIncludeDepth {
+						continue
+					}
+					storage, files, err := resolveIncludeTargets(n, ctx)
+					if err != nil {
+						continue
+					}
+					nctx := getContext{baseDir: ctx.baseDir, depth: ctx.depth + 1, storage: storage}
+					for _, f := range files {
+						sub, err := decodeFile(storage, f)
+						if err != nil {
+							continue
+						}
+						walk(sub.Hosts, nctx)
+					}
+					continue
+				}
+				switch {
+				case !haveHostname && strings.EqualFold(n.key, "Hostname"):
+					mctx.Host = expandTokens(n.Value(), mctx)
+					haveHostname = true
+				case !haveUser && strings.EqualFold(n.key, "User"):
+					mctx.User = n.Value()
+					haveUser = true
+				case strings.EqualFold(n.key, "Tag"):
+					tags = append(tags, n.Value())
+				}
+			}
+		}
+	}
+	walk(hosts, ctx)
+	return mctx, tags
+}
+
+// matchesForResolve is like matches, but a "Match final" block is never
+// eligible: final blocks are only evaluated once resolveMatchContext has
+// finished and the real (second) pass runs.
+func (h *Host) matchesForResolve(mctx MatchContext, tags []string) bool {
+	if h.isMatch && h.isFinal() {
+		return false
+	}
+	return h.matches(mctx, tags)
+}
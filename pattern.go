@@ -0,0 +1,59 @@
+package ssh_config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern is a single compiled entry from a Host or Match pattern list, e.g.
+// "*.example.com" or the negated "!*.dialup.example.com".
+type Pattern struct {
+	Negated bool
+
+	text  string
+	regex *regexp.Regexp
+}
+
+// String returns the pattern exactly as it was given to NewPattern.
+func (p *Pattern) String() string {
+	return p.text
+}
+
+// NewPattern compiles a single ssh_config pattern. '*' matches zero or more
+// characters, '?' matches exactly one; every other character is literal
+// (including '.'). A leading '!' negates the pattern.
+func NewPattern(s string) (*Pattern, error) {
+	if s == "" {
+		return nil, fmt.Errorf("ssh_config: empty pattern")
+	}
+	negated := false
+	rest := s
+	if strings.HasPrefix(rest, "!") {
+		negated = true
+		rest = rest[1:]
+	}
+	if rest == "" {
+		return nil, fmt.Errorf("ssh_config: empty pattern %q", s)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range rest {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("ssh_config: invalid pattern %q: %v", s, err)
+	}
+	return &Pattern{Negated: negated, text: s, regex: re}, nil
+}
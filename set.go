@@ -0,0 +1,194 @@
+package ssh_config
+
+import "strings"
+
+// SetHost sets key to value in the Host block that declares alias as one
+// of its patterns, rewriting the first existing line for key in place
+// (preserving its original key spelling and its "Key value" vs
+// "Key=value" separator style; a trailing inline comment on that line is
+// not preserved, since line.Value() doesn't model those as distinct from
+// the value either) or appending a new line if key isn't set yet. Every
+// other line is untouched. If no Host block declares alias, one is
+// created (see AddHost) and the line appended there.
+func (c *Config) SetHost(alias, key, value string) {
+	h := c.findExactHost(alias)
+	if h == nil {
+		h = c.AddHost([]string{alias})
+	}
+	for _, n := range h.Nodes {
+		if n.kind == kindKV && strings.EqualFold(n.key, key) {
+			n.setValue(value)
+			return
+		}
+	}
+	h.Nodes = append(h.Nodes, newKVLine(key, value, styleOf(h.Nodes, c.eolStyle())))
+}
+
+// AppendHost appends a new key/value line to the Host block that declares
+// alias as one of its patterns, without touching any existing line for
+// key, the way a multi-valued directive like IdentityFile accumulates
+// rather than overwrites. If no such Host block exists, one is created
+// (see AddHost).
+func (c *Config) AppendHost(alias, key, value string) {
+	h := c.findExactHost(alias)
+	if h == nil {
+		h = c.AddHost([]string{alias})
+	}
+	h.Nodes = append(h.Nodes, newKVLine(key, value, styleOf(h.Nodes, c.eolStyle())))
+}
+
+// UnsetHost removes every line for key from the Host block that declares
+// alias as one of its patterns. It does nothing if no such block exists.
+func (c *Config) UnsetHost(alias, key string) {
+	h := c.findExactHost(alias)
+	if h == nil {
+		return
+	}
+	nodes := h.Nodes[:0]
+	for _, n := range h.Nodes {
+		if n.kind == kindKV && strings.EqualFold(n.key, key) {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	h.Nodes = nodes
+}
+
+// AddHost appends a brand new `Host patterns...` block to the end of the
+// config and returns it, ready for SetHost/AppendHost to fill in.
+func (c *Config) AddHost(patterns []string) *Host {
+	eol := c.eolStyle()
+	if c.hasContent() {
+		c.appendBlankLine(eol)
+	}
+	h := &Host{
+		header:   &line{body: "Host " + strings.Join(patterns, " "), eol: eol},
+		Patterns: compilePatterns(patterns),
+	}
+	c.Hosts = append(c.Hosts, h)
+	return h
+}
+
+// RemoveHost removes the Host block that declares alias as one of its
+// patterns. It does nothing if no such block exists.
+func (c *Config) RemoveHost(alias string) {
+	if i := c.findExactHostIndex(alias); i >= 0 {
+		c.Hosts = append(c.Hosts[:i], c.Hosts[i+1:]...)
+	}
+}
+
+// findExactHost returns the Host block (never a Match block or the
+// implicit one) that literally declares alias as one of its patterns, the
+// same block a config-editing tool like Terraform's ssh_config provider
+// would target for a given alias.
+func (c *Config) findExactHost(alias string) *Host {
+	if i := c.findExactHostIndex(alias); i >= 0 {
+		return c.Hosts[i]
+	}
+	return nil
+}
+
+func (c *Config) findExactHostIndex(alias string) int {
+	for i, h := range c.Hosts {
+		if h.implicit || h.isMatch {
+			continue
+		}
+		for _, p := range hostPatterns(h.header.body) {
+			if p == alias {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// eolStyle reports the line-ending convention already in use (so a newly
+// appended Host block matches a DOS-line-ending file instead of silently
+// mixing conventions), defaulting to "\n" for an empty config.
+func (c *Config) eolStyle() string {
+	for _, h := range c.Hosts {
+		if h.header != nil && h.header.eol != "" {
+			return h.header.eol
+		}
+		for _, n := range h.Nodes {
+			if n.eol != "" {
+				return n.eol
+			}
+		}
+	}
+	return "\n"
+}
+
+func (c *Config) hasContent() bool {
+	if len(c.Hosts) == 0 {
+		return false
+	}
+	if len(c.Hosts) > 1 {
+		return true
+	}
+	return len(c.Hosts[0].Nodes) > 0
+}
+
+func (c *Config) appendBlankLine(eol string) {
+	if len(c.Hosts) == 0 {
+		return
+	}
+	last := c.Hosts[len(c.Hosts)-1]
+	last.Nodes = append(last.Nodes, &line{eol: eol, kind: kindBlank})
+}
+
+// kvStyle is the indentation and line ending a new line appended to a Host
+// block should use, sampled from its existing lines.
+type kvStyle struct {
+	indent string
+	eol    string
+}
+
+func styleOf(nodes []*line, fallbackEOL string) kvStyle {
+	for _, n := range nodes {
+		if n.kind == kindKV {
+			return kvStyle{indent: n.leading, eol: n.eol}
+		}
+	}
+	return kvStyle{indent: "    ", eol: fallbackEOL}
+}
+
+func newKVLine(key, value string, style kvStyle) *line {
+	return &line{
+		leading: style.indent,
+		body:    key + " " + quoteIfNeeded(value),
+		eol:     style.eol,
+		kind:    kindKV,
+		key:     key,
+	}
+}
+
+// setValue rewrites l's value, keeping its key spelling and separator
+// ("Key value" vs "Key=value", including surrounding spaces) exactly as
+// written.
+func (l *line) setValue(value string) {
+	_, rest := splitKeyRest(l.body)
+	prefixLen := len(l.body) - len(rest)
+	l.body = l.body[:prefixLen] + quoteIfNeeded(value)
+}
+
+// quoteIfNeeded quotes value if it contains whitespace or '#' (either of
+// which would otherwise either split it into multiple tokens or truncate
+// it at a comment when read back), preferring double quotes unless value
+// itself contains one. tokenize has no escape mechanism, so a value
+// containing both quote characters has no representation that survives a
+// round trip; quoteIfNeeded still picks double quotes for that case
+// rather than the single-quote fallback, which would be wrong in exactly
+// the same way but also clash with a literal single quote in value.
+func quoteIfNeeded(value string) string {
+	if value == "" {
+		return `""`
+	}
+	if !strings.ContainsAny(value, " \t#") {
+		return value
+	}
+	if strings.Contains(value, `"`) && !strings.Contains(value, "'") {
+		return "'" + value + "'"
+	}
+	return `"` + value + `"`
+}
@@ -0,0 +1,277 @@
+package ssh_config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// UserSettings combines a user config and a system config the way OpenSSH's
+// client does: the user config is consulted first, the system config fills
+// in anything the user config didn't set, and registered defaults fill in
+// anything neither config set.
+type UserSettings struct {
+	userConfigFinder   func() string
+	systemConfigFinder func() string
+	storage            Storage
+
+	loadOnce sync.Once
+
+	mu      sync.RWMutex
+	loadErr error
+	user    *Config
+	system  *Config
+
+	watcher *Watcher
+}
+
+// ConfigFinder overrides the function used to locate the user's config
+// file (~/.ssh/config by default).
+func (u *UserSettings) ConfigFinder(f func() string) {
+	u.userConfigFinder = f
+}
+
+// SetStorage overrides the Storage used to read the user config, the system
+// config, and every file reached through Include. The default reads the
+// local filesystem.
+func (u *UserSettings) SetStorage(s Storage) {
+	u.storage = s
+}
+
+func (u *UserSettings) storageOrDefault() Storage {
+	if u.storage != nil {
+		return u.storage
+	}
+	return defaultStorage
+}
+
+func defaultUserConfigPath() string {
+	return filepath.Join(homedir(), ".ssh", "config")
+}
+
+func defaultSystemConfigPath() string {
+	return filepath.Join(string(filepath.Separator), "etc", "ssh", "ssh_config")
+}
+
+func (u *UserSettings) userConfigPath() string {
+	if u.userConfigFinder != nil {
+		return u.userConfigFinder()
+	}
+	return defaultUserConfigPath()
+}
+
+func (u *UserSettings) systemConfigPath() string {
+	if u.systemConfigFinder != nil {
+		return u.systemConfigFinder()
+	}
+	return defaultSystemConfigPath()
+}
+
+// userBaseDir and systemBaseDir are the directories relative Include
+// targets are resolved against. With the default on-disk Storage this is
+// ~/.ssh and /etc/ssh, matching real OpenSSH (which resolves a user
+// config's Include targets against ~/.ssh regardless of which file
+// actually supplied that config). Once a custom Storage has been
+// installed via SetStorage, though, there's no real OS home directory to
+// fall back on, and its layout won't generally mirror one anyway, so
+// relative Include targets are resolved against the directory of the
+// actual resolved user/system config path instead.
+func (u *UserSettings) userBaseDir() string {
+	if u.storage == nil {
+		return filepath.Join(homedir(), ".ssh")
+	}
+	return filepath.Dir(u.userConfigPath())
+}
+
+func (u *UserSettings) systemBaseDir() string {
+	if u.storage == nil {
+		return filepath.Join(string(filepath.Separator), "etc", "ssh")
+	}
+	return filepath.Dir(u.systemConfigPath())
+}
+
+// watchTargets returns every file a Watcher should hold an fsnotify watch
+// on: the user config, the system config, and every file reachable from
+// either through Include.
+func (u *UserSettings) watchTargets() []string {
+	u.mu.RLock()
+	user, system := u.user, u.system
+	u.mu.RUnlock()
+
+	var out []string
+	if p := u.userConfigPath(); p != "" {
+		out = append(out, p)
+	}
+	if p := u.systemConfigPath(); p != "" {
+		out = append(out, p)
+	}
+	if user != nil {
+		out = append(out, includeFiles(user, getContext{baseDir: u.userBaseDir(), storage: u.storageOrDefault()})...)
+	}
+	if system != nil {
+		out = append(out, includeFiles(system, getContext{baseDir: u.systemBaseDir(), storage: u.storageOrDefault()})...)
+	}
+	return out
+}
+
+func (u *UserSettings) load() {
+	u.loadOnce.Do(func() {
+		if err := u.reload(); err != nil {
+			u.mu.Lock()
+			u.loadErr = err
+			u.mu.Unlock()
+		}
+	})
+}
+
+// reload re-parses the user and system config and atomically swaps them
+// in, so a Watch goroutine can refresh an already-loaded UserSettings
+// without concurrent Get/GetAll/GetStrict callers ever seeing a partial
+// update.
+func (u *UserSettings) reload() error {
+	user, err := u.loadOne(u.userConfigPath())
+	if err != nil {
+		return err
+	}
+	system, err := u.loadOne(u.systemConfigPath())
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	u.user, u.system, u.loadErr = user, system, nil
+	u.mu.Unlock()
+	return nil
+}
+
+func (u *UserSettings) loadOne(path string) (*Config, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := u.storageOrDefault().Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+func (u *UserSettings) lookup(mctx MatchContext, alias, key string, all bool) ([]string, error) {
+	u.load()
+
+	mctx.OriginalHost = alias
+	if mctx.Host == "" {
+		mctx.Host = alias
+	}
+
+	u.mu.RLock()
+	userCfg, system, loadErr := u.user, u.system, u.loadErr
+	u.mu.RUnlock()
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	var results []string
+	if userCfg != nil {
+		base := getContext{baseDir: u.userBaseDir(), storage: u.storageOrDefault()}
+		vals, err := userCfg.getAll(key, all, userCfg.resolveCtx(mctx, base))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, vals...)
+	}
+	if (all || len(results) == 0) && system != nil {
+		base := getContext{baseDir: u.systemBaseDir(), storage: u.storageOrDefault()}
+		vals, err := system.getAll(key, all, system.resolveCtx(mctx, base))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, vals...)
+	}
+	if len(results) == 0 {
+		if def := Default(key); def != "" {
+			results = []string{def}
+		}
+	}
+	if !all && len(results) > 1 {
+		results = results[:1]
+	}
+	for i, v := range results {
+		results[i] = cookValue(v)
+	}
+	return results, nil
+}
+
+// Get returns the first value for key in the Host block(s) matching alias,
+// falling back to the system config and then to any registered default. It
+// discards any error; use GetStrict to see it.
+func (u *UserSettings) Get(alias, key string) string {
+	val, _ := u.GetStrict(alias, key)
+	return val
+}
+
+// GetStrict is Get, but returns a parse/validation/IO error instead of
+// silently swallowing it.
+func (u *UserSettings) GetStrict(alias, key string) (string, error) {
+	return u.getStrict(defaultMatchContext(alias), alias, key)
+}
+
+// GetWithContext is Get, but evaluates Match directives (host, originalhost,
+// user, localuser, exec, tagged, all, final, canonical) against the given
+// MatchContext instead of the default one Get synthesizes. ctx.OriginalHost
+// is always set to alias, and ctx.Host defaults to alias too when left
+// empty, so callers only need to fill in whichever fields their Match
+// criteria actually depend on (User, LocalUser, ExecRunner, or a
+// post-substitution Host).
+func (u *UserSettings) GetWithContext(ctx MatchContext, alias, key string) (string, error) {
+	return u.getStrict(ctx, alias, key)
+}
+
+func (u *UserSettings) getStrict(mctx MatchContext, alias, key string) (string, error) {
+	vals, err := u.lookup(mctx, alias, key, false)
+	if err != nil {
+		return "", err
+	}
+	val := ""
+	if len(vals) > 0 {
+		val = vals[0]
+	}
+	if err := validate(key, val); err != nil {
+		return "", err
+	}
+	return val, nil
+}
+
+// GetAll returns every value for key, across the user config, system
+// config, and any registered default, discarding any error.
+func (u *UserSettings) GetAll(alias, key string) []string {
+	vals, _ := u.GetAllStrict(alias, key)
+	return vals
+}
+
+// GetAllStrict is GetAll, but returns a parse/validation/IO error instead of
+// silently swallowing it.
+func (u *UserSettings) GetAllStrict(alias, key string) ([]string, error) {
+	return u.getAllStrict(defaultMatchContext(alias), alias, key)
+}
+
+// GetAllWithContext is GetAllStrict, evaluating Match directives against ctx
+// the same way GetWithContext does for GetStrict.
+func (u *UserSettings) GetAllWithContext(ctx MatchContext, alias, key string) ([]string, error) {
+	return u.getAllStrict(ctx, alias, key)
+}
+
+func (u *UserSettings) getAllStrict(mctx MatchContext, alias, key string) ([]string, error) {
+	vals, err := u.lookup(mctx, alias, key, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vals {
+		if err := validate(key, v); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
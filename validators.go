@@ -0,0 +1,31 @@
+package ssh_config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// validatorsByLowerKey holds per-key value validation, keyed by the
+// lowercased canonical key name so lookups are case-insensitive like
+// everything else in this package.
+var validatorsByLowerKey = map[string]func(string) error{
+	"port": validatePort,
+}
+
+func validatePort(v string) error {
+	if v == "" {
+		return nil
+	}
+	if _, err := strconv.ParseUint(v, 10, 16); err != nil {
+		return fmt.Errorf("ssh_config: %v", err)
+	}
+	return nil
+}
+
+func validate(key, value string) error {
+	if fn, ok := validatorsByLowerKey[strings.ToLower(key)]; ok {
+		return fn(value)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package ssh_config
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// settleDelay is how long loop waits after the last fsnotify event on a
+// watched file before reparsing and reporting it. An editor's
+// rename-on-save fires Remove then Create (sometimes with a Write in
+// between) for what is, to a caller, a single edit; without this, each of
+// those would reach the events channel as its own Event, and a consumer
+// draining one event per change would leave the extra one queued, stalling
+// delivery of the next real edit behind it.
+const settleDelay = 50 * time.Millisecond
+
+// Event reports the result of a reparse triggered by a Watcher after one of
+// its watched files changed, or (with File empty) an error reported by
+// fsnotify itself, in which case no reparse took place.
+type Event struct {
+	// File is the path that changed and triggered the reparse. Rapid-fire
+	// changes to more than one watched file within settleDelay are
+	// coalesced into a single Event, in which case File is just one of
+	// them (not necessarily the first) — Err and the reload itself still
+	// cover every file that changed.
+	File string
+	// Err is the parse/IO error from the reparse, or nil if it succeeded
+	// and the UserSettings' cached Config was swapped in.
+	Err error
+}
+
+// Watcher keeps fsnotify watches on a UserSettings' user config, system
+// config, and every file reachable through Include, re-parsing and
+// atomically swapping the cached Config whenever one of them changes.
+type Watcher struct {
+	us *UserSettings
+
+	mu      sync.Mutex
+	fsw     *fsnotify.Watcher
+	events  chan Event
+	done    chan struct{}
+	watched map[string]bool
+}
+
+// Watch starts watching u's user config, system config, and every file
+// reached through Include, re-parsing on change and atomically swapping
+// the cached Config so concurrent Get/GetAll/GetStrict calls always see a
+// consistent snapshot. The returned channel is closed when ctx is done or
+// the Watcher is stopped. Watch is safe to call more than once; later
+// calls return the same Watcher's channel.
+func (u *UserSettings) Watch(ctx context.Context) (<-chan Event, error) {
+	u.mu.Lock()
+	w := u.watcher
+	if w == nil {
+		w = &Watcher{us: u}
+		u.watcher = w
+	}
+	u.mu.Unlock()
+	return w.Start(ctx)
+}
+
+// Start begins watching, or re-starts after a prior Stop.
+func (w *Watcher) Start(ctx context.Context) (<-chan Event, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fsw != nil {
+		return w.events, nil
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w.us.load()
+
+	w.fsw = fsw
+	w.events = make(chan Event)
+	w.done = make(chan struct{})
+	w.watched = make(map[string]bool)
+	w.addWatches()
+
+	go w.loop(ctx)
+	return w.events, nil
+}
+
+// Stop tears down the fsnotify watch and closes the event channel. It is
+// safe to call Stop multiple times, and to Start again afterward.
+func (w *Watcher) Stop() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fsw == nil {
+		return nil
+	}
+	err := w.fsw.Close()
+	close(w.done)
+	w.fsw = nil
+	return err
+}
+
+func (w *Watcher) loop(ctx context.Context) {
+	w.mu.Lock()
+	fsw, done, events := w.fsw, w.done, w.events
+	w.mu.Unlock()
+
+	defer close(events)
+	if fsw == nil {
+		// Stopped before this goroutine got to run at all.
+		return
+	}
+
+	var settle *time.Timer
+	var settleC <-chan time.Time
+	var pendingFile string
+	stopSettle := func() {
+		if settle != nil {
+			settle.Stop()
+			settle, settleC = nil, nil
+		}
+	}
+	defer stopSettle()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.Stop()
+			return
+		case <-done:
+			return
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return
+			}
+			w.rewatch(ev)
+			pendingFile = ev.Name
+			stopSettle()
+			settle = time.NewTimer(settleDelay)
+			settleC = settle.C
+		case <-settleC:
+			settle, settleC = nil, nil
+			w.handle(pendingFile, events, done)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return
+			}
+			select {
+			case events <- Event{Err: err}:
+			case <-done:
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// rewatch re-adds the fsnotify watch if the editor replaced the file (the
+// common rename-on-save pattern drops fsnotify's watch on the old inode).
+func (w *Watcher) rewatch(ev fsnotify.Event) {
+	if ev.Op&(fsnotify.Remove|fsnotify.Rename) == 0 {
+		return
+	}
+	w.mu.Lock()
+	if w.fsw != nil {
+		w.fsw.Add(ev.Name)
+	}
+	w.mu.Unlock()
+}
+
+// handle re-parses after settleDelay has passed with no further fsnotify
+// activity, swaps in the result, and reports what happened as a single
+// Event, however many raw fsnotify events the edit that triggered it fired.
+func (w *Watcher) handle(file string, events chan Event, done chan struct{}) {
+	err := w.us.reload()
+	w.mu.Lock()
+	if w.fsw != nil {
+		w.addWatches()
+	}
+	w.mu.Unlock()
+
+	select {
+	case events <- Event{File: file, Err: err}:
+	case <-done:
+	}
+}
+
+// addWatches adds an fsnotify watch for every file watchTargets reports
+// that isn't already watched. Callers must hold w.mu.
+func (w *Watcher) addWatches() {
+	for _, f := range w.us.watchTargets() {
+		if f == "" || w.watched[f] {
+			continue
+		}
+		if err := w.fsw.Add(f); err == nil {
+			w.watched[f] = true
+		}
+	}
+}
+
+// includeFiles returns every file reachable from cfg via Include,
+// transitively, the same way Get's Include expansion would follow them.
+// Unlike expandInclude it never fails the caller: a broken or too-deep
+// Include chain just stops that branch early, since a Watcher should keep
+// watching everything else rather than give up entirely.
+func includeFiles(cfg *Config, ctx getContext) []string {
+	var out []string
+	var walk func(nodes []*line, ctx getContext)
+	walk = func(nodes []*line, ctx getContext) {
+		if ctx.depth+1 > maxIncludeDepth {
+			return
+		}
+		for _, n := range nodes {
+			if n.kind != kindKV || !strings.EqualFold(n.key, "Include") {
+				continue
+			}
+			storage, files, err := resolveIncludeTargets(n, ctx)
+			if err != nil {
+				continue
+			}
+			nctx := getContext{baseDir: ctx.baseDir, depth: ctx.depth + 1, storage: storage}
+			for _, f := range files {
+				out = append(out, f)
+				rc, err := storage.Open(f)
+				if err != nil {
+					continue
+				}
+				data, err := io.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					continue
+				}
+				sub := decodeBytes(data)
+				for _, h := range sub.Hosts {
+					walk(h.Nodes, nctx)
+				}
+			}
+		}
+	}
+	for _, h := range cfg.Hosts {
+		walk(h.Nodes, ctx)
+	}
+	return out
+}
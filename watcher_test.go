@@ -0,0 +1,129 @@
+package ssh_config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte("Host wap\n    Port 1111\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	us := &UserSettings{userConfigFinder: testConfigFinder(path)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := us.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if val := us.Get("wap", "Port"); val != "1111" {
+		t.Fatalf("expected Port 1111 before edit, got %q", val)
+	}
+
+	if err := os.WriteFile(path, []byte("Host wap\n    Port 2222\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Err != nil {
+			t.Fatalf("unexpected reparse error: %v", ev.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for watch event")
+	}
+
+	if val := us.Get("wap", "Port"); val != "2222" {
+		t.Errorf("expected Port 2222 after edit, got %q", val)
+	}
+
+	if err := us.watcher.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := us.watcher.Stop(); err != nil {
+		t.Fatalf("Stop should be idempotent, got %v", err)
+	}
+	if _, err := us.watcher.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := us.watcher.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWatcherCoalescesRenameOnSave reproduces an editor's rename-on-save
+// save path (write to a temp file, then rename over the target), which
+// fires a Remove and a Create for what is, to a Watch consumer, a single
+// edit. A consumer draining exactly one event per change must still see
+// each edit and must not have a second, unread event left queued behind
+// it that would stall delivery of the next edit.
+func TestWatcherCoalescesRenameOnSave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte("Host wap\n    Port 1111\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	us := &UserSettings{userConfigFinder: testConfigFinder(path)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := us.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renameOnSave := func(content string) {
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	renameOnSave("Host wap\n    Port 2222\n")
+	select {
+	case ev := <-events:
+		if ev.Err != nil {
+			t.Fatalf("unexpected reparse error: %v", ev.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for first watch event")
+	}
+	if val := us.Get("wap", "Port"); val != "2222" {
+		t.Errorf("expected Port 2222 after first edit, got %q", val)
+	}
+
+	select {
+	case ev := <-events:
+		t.Fatalf("rename-on-save produced a second, unread event: %+v", ev)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	renameOnSave("Host wap\n    Port 3333\n")
+	select {
+	case ev := <-events:
+		if ev.Err != nil {
+			t.Fatalf("unexpected reparse error: %v", ev.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for second watch event")
+	}
+	if val := us.Get("wap", "Port"); val != "3333" {
+		t.Errorf("expected Port 3333 after second edit, got %q", val)
+	}
+
+	if err := us.watcher.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}